@@ -0,0 +1,102 @@
+package creds
+
+import (
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// providerSecretSeparator is the delimiter used in a pipeline var reference
+// like ((vault-prod:my-secret)) to pin the lookup to a single named provider
+// instead of falling through the whole chain.
+const providerSecretSeparator = ":"
+
+// ChainFactory implements SecretsFactory by delegating to a fixed, ordered
+// list of underlying SecretsFactory instances.
+type ChainFactory struct {
+	log         lager.Logger
+	providerIDs []string
+	factories   []SecretsFactory
+}
+
+// Batch prefetches secretNames for the given team/pipeline from every
+// underlying factory that supports batching, so a chain including a
+// caching provider still gets the benefit of a single round trip per
+// provider instead of falling back to N serial GETs through the chain.
+func (factory *ChainFactory) Batch(team, pipeline string, secretNames []string) error {
+	var lastErr error
+
+	for _, f := range factory.factories {
+		if err := PrefetchIfSupported(f, team, pipeline, secretNames); err != nil {
+			lastErr = err
+		}
+	}
+
+	return lastErr
+}
+
+func (factory *ChainFactory) NewSecrets() Secrets {
+	secrets := make([]Secrets, len(factory.factories))
+	for i, f := range factory.factories {
+		secrets[i] = f.NewSecrets()
+	}
+
+	return &chainSecrets{
+		log:         factory.log,
+		providerIDs: factory.providerIDs,
+		secrets:     secrets,
+	}
+}
+
+type chainSecrets struct {
+	log         lager.Logger
+	providerIDs []string
+	secrets     []Secrets
+}
+
+// Get consults each underlying Secrets in configured order and returns the
+// first hit. If name is pinned to a provider via "provider-id:secret-name",
+// only that provider is consulted. A provider that errors does not fail the
+// whole lookup - the point of a chain is that one unreachable or
+// misconfigured manager shouldn't break secrets that live in a healthy one
+// later in the chain - so its error is logged and the next provider is
+// tried; only running out of providers without a hit returns the last error.
+func (chain *chainSecrets) Get(name string) (interface{}, *time.Time, bool, error) {
+	if providerID, secretName, ok := splitProviderPrefix(name); ok {
+		for i, id := range chain.providerIDs {
+			if id == providerID {
+				return chain.secrets[i].Get(secretName)
+			}
+		}
+		return nil, nil, false, nil
+	}
+
+	var lastErr error
+
+	for i, secrets := range chain.secrets {
+		value, expiration, found, err := secrets.Get(name)
+		if err != nil {
+			if chain.log != nil {
+				chain.log.Error("get-secret-from-provider", err, lager.Data{"provider": chain.providerIDs[i]})
+			}
+			lastErr = err
+			continue
+		}
+		if found {
+			return value, expiration, true, nil
+		}
+	}
+
+	return nil, nil, false, lastErr
+}
+
+// splitProviderPrefix parses the "provider-id:secret-name" pipeline
+// annotation syntax used to pin a lookup to a single credential manager.
+func splitProviderPrefix(name string) (providerID string, secretName string, ok bool) {
+	parts := strings.SplitN(name, providerSecretSeparator, 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
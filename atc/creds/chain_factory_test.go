@@ -0,0 +1,105 @@
+package creds
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+)
+
+type fakeSecrets struct {
+	values map[string]interface{}
+	err    error
+}
+
+func (f *fakeSecrets) Get(name string) (interface{}, *time.Time, bool, error) {
+	if f.err != nil {
+		return nil, nil, false, f.err
+	}
+
+	value, found := f.values[name]
+	return value, nil, found, nil
+}
+
+func TestSplitProviderPrefix(t *testing.T) {
+	cases := []struct {
+		name           string
+		input          string
+		wantProviderID string
+		wantSecretName string
+		wantOK         bool
+	}{
+		{"no prefix", "my-secret", "", "", false},
+		{"pinned to a provider", "vault-prod:my-secret", "vault-prod", "my-secret", true},
+		{"secret name containing a colon", "vault-prod:path:my-secret", "vault-prod", "path:my-secret", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			providerID, secretName, ok := splitProviderPrefix(c.input)
+			if ok != c.wantOK || providerID != c.wantProviderID || secretName != c.wantSecretName {
+				t.Errorf("splitProviderPrefix(%q) = (%q, %q, %v), want (%q, %q, %v)",
+					c.input, providerID, secretName, ok, c.wantProviderID, c.wantSecretName, c.wantOK)
+			}
+		})
+	}
+}
+
+func TestChainSecretsGetFallsThroughOnError(t *testing.T) {
+	secrets := &chainSecrets{
+		log:         lagertest.NewTestLogger("chain"),
+		providerIDs: []string{"broken-provider", "healthy-provider"},
+		secrets: []Secrets{
+			&fakeSecrets{err: errors.New("provider unreachable")},
+			&fakeSecrets{values: map[string]interface{}{"my-secret": "the-value"}},
+		},
+	}
+
+	value, _, found, err := secrets.Get("my-secret")
+	if err != nil {
+		t.Fatalf("Get() returned error %v, want nil since a later provider resolved the secret", err)
+	}
+	if !found || value != "the-value" {
+		t.Fatalf("Get() = (%v, _, %v, _), want (the-value, _, true, _)", value, found)
+	}
+}
+
+func TestChainSecretsGetReturnsLastErrorWhenNoProviderResolves(t *testing.T) {
+	wantErr := errors.New("provider unreachable")
+
+	secrets := &chainSecrets{
+		log:         lagertest.NewTestLogger("chain"),
+		providerIDs: []string{"broken-provider"},
+		secrets: []Secrets{
+			&fakeSecrets{err: wantErr},
+		},
+	}
+
+	_, _, found, err := secrets.Get("my-secret")
+	if found {
+		t.Fatalf("Get() reported found=true with no provider able to resolve the secret")
+	}
+	if err != wantErr {
+		t.Fatalf("Get() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestChainSecretsGetPinnedToProvider(t *testing.T) {
+	secrets := &chainSecrets{
+		log:         lagertest.NewTestLogger("chain"),
+		providerIDs: []string{"conjur-prod", "vault-prod"},
+		secrets: []Secrets{
+			&fakeSecrets{values: map[string]interface{}{"my-secret": "from-conjur"}},
+			&fakeSecrets{values: map[string]interface{}{"my-secret": "from-vault"}},
+		},
+	}
+
+	value, _, found, err := secrets.Get("vault-prod:my-secret")
+	if err != nil {
+		t.Fatalf("Get() returned error %v", err)
+	}
+	if !found || value != "from-vault" {
+		t.Fatalf("Get() = (%v, _, %v, _), want (from-vault, _, true, _)", value, found)
+	}
+}
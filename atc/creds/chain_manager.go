@@ -0,0 +1,203 @@
+package creds
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/tedsuo/ifrit"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// ChainManagerFlags is the single flag group the ATC command needs to embed
+// (e.g. `CredentialManagers creds.ChainManagerFlags \`group:"Credential
+// Managers"\`` on its top-level RunCommand) to offer operators chaining in
+// addition to the existing single-manager `--creds-*` flags. Once embedded,
+// the command calls Build() after flag parsing and, for a non-nil result,
+// drives it exactly like it already drives a single Manager: Init, Validate,
+// NewSecretsFactory, Runners (for its own ifrit process group), and
+// PopulateInfo (for the info endpoint).
+type ChainManagerFlags struct {
+	CredentialManagersFile string `long:"credential-managers-file" description:"Path to a YAML or JSON file describing multiple credential managers to consult in order, e.g. two Conjur instances"`
+}
+
+// Build loads and instantiates the chain described by CredentialManagersFile,
+// or returns a nil ChainManager if the flag was not set.
+func (flags ChainManagerFlags) Build() (*ChainManager, error) {
+	if flags.CredentialManagersFile == "" {
+		return nil, nil
+	}
+
+	return NewChainManagerFromFile(flags.CredentialManagersFile)
+}
+
+// ChainManager wraps a slice of credential managers, configured from a
+// --credential-managers-file document, and consults them in order. It lets
+// an operator run several managers of the types registered in
+// ManagerFactories (e.g. a primary and a DR Conjur instance) side by side
+// instead of being limited to the single manager picked by top-level flags.
+type ChainManager struct {
+	Providers []ProviderConfig
+	managers  []Manager
+}
+
+// NewChainManagerFromFile loads a --credential-managers-file document and
+// instantiates each configured provider's Manager.
+func NewChainManagerFromFile(path string) (*ChainManager, error) {
+	configs, err := LoadProviderConfigs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	managers := make([]Manager, len(configs))
+	for i, config := range configs {
+		manager, err := buildManager(config)
+		if err != nil {
+			return nil, err
+		}
+		managers[i] = manager
+	}
+
+	return &ChainManager{
+		Providers: configs,
+		managers:  managers,
+	}, nil
+}
+
+func (chain *ChainManager) Init(log lager.Logger) error {
+	for i, manager := range chain.managers {
+		if err := manager.Init(log.Session("provider", lager.Data{"id": chain.Providers[i].ID})); err != nil {
+			return fmt.Errorf("provider %q: %w", chain.Providers[i].ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (chain *ChainManager) IsConfigured() bool {
+	return len(chain.managers) > 0
+}
+
+func (chain *ChainManager) Validate() error {
+	for i, manager := range chain.managers {
+		if err := manager.Validate(); err != nil {
+			return fmt.Errorf("provider %q: %w", chain.Providers[i].ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Health reports each provider's health under its configured id, in
+// addition to an overall status, so the existing HealthResponse.Response
+// map surfaces per-manager detail rather than one opaque blob.
+func (chain *ChainManager) Health() (*HealthResponse, error) {
+	response := map[string]string{
+		"status": "UP",
+	}
+
+	for i, manager := range chain.managers {
+		id := chain.Providers[i].ID
+
+		health, err := manager.Health()
+		if err != nil {
+			response[id] = fmt.Sprintf("ERROR: %s", err)
+			response["status"] = "DEGRADED"
+			continue
+		}
+
+		status := "UP"
+		if s, ok := health.Response["status"]; ok {
+			status = s
+		}
+		if status != "UP" {
+			response["status"] = "DEGRADED"
+		}
+		response[id] = status
+	}
+
+	return &HealthResponse{
+		Method:   "ChainHealth",
+		Response: response,
+	}, nil
+}
+
+// Runners collects the background ifrit.Runner for every provider in the
+// chain that needs one (e.g. Conjur in k8s/JWT mode), for the ATC command to
+// add to its own ifrit process group alongside the single top-level manager
+// returned by the existing --creds-* flags path.
+func (chain *ChainManager) Runners() []ifrit.Runner {
+	return Runners(chain.managers...)
+}
+
+// CredentialManagerInfos reports per-provider health in the shape the ATC
+// info endpoint exposes to fly and the dashboard, so operators can tell
+// which provider in the chain is down without scraping logs.
+func (chain *ChainManager) CredentialManagerInfos() []atc.CredentialManagerInfo {
+	infos := make([]atc.CredentialManagerInfo, len(chain.managers))
+
+	for i, manager := range chain.managers {
+		config := chain.Providers[i]
+
+		info := atc.CredentialManagerInfo{
+			Name: config.ID,
+			Type: config.Type,
+		}
+
+		health, err := manager.Health()
+		if err != nil {
+			info.Details = map[string]string{"error": err.Error()}
+		} else {
+			info.Healthy = health.Response["status"] == "UP"
+			info.Details = health.Response
+		}
+
+		infos[i] = info
+	}
+
+	return infos
+}
+
+// PopulateInfo fills in info.CredentialManagers from the chain's current
+// per-provider health, for the ATC info handler to call alongside its other
+// info.* assignments before serving GET /api/v1/info.
+func (chain *ChainManager) PopulateInfo(info *atc.Info) {
+	info.CredentialManagers = chain.CredentialManagerInfos()
+}
+
+// Purge evicts every cached secret for the given team/pipeline from every
+// provider in the chain that supports caching (i.e. implements Purger). It's
+// meant to be wired into the pipeline-save code path so that a fly
+// set-pipeline or pause-pipeline deterministically picks up rotated secrets,
+// regardless of which provider in the chain holds them.
+func (chain *ChainManager) Purge(team, pipeline string) {
+	for _, manager := range chain.managers {
+		PurgeIfSupported(manager, team, pipeline)
+	}
+}
+
+func (chain *ChainManager) NewSecretsFactory(log lager.Logger) (SecretsFactory, error) {
+	factories := make([]SecretsFactory, len(chain.managers))
+
+	for i, manager := range chain.managers {
+		factory, err := manager.NewSecretsFactory(log.Session("provider", lager.Data{"id": chain.Providers[i].ID}))
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", chain.Providers[i].ID, err)
+		}
+		factories[i] = factory
+	}
+
+	return &ChainFactory{
+		log:         log,
+		providerIDs: providerIDs(chain.Providers),
+		factories:   factories,
+	}, nil
+}
+
+func providerIDs(configs []ProviderConfig) []string {
+	ids := make([]string, len(configs))
+	for i, config := range configs {
+		ids[i] = config.ID
+	}
+	return ids
+}
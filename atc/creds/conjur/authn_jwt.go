@@ -0,0 +1,98 @@
+package conjur
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// jwtAuthenticator implements tokenAuthenticator using Conjur's authn-jwt
+// authenticator: it exchanges a JWT minted by an external identity provider
+// (GitHub Actions, a cloud workload identity, Vault, ...) for a short-lived
+// Conjur access token.
+type jwtAuthenticator struct {
+	log          lager.Logger
+	applianceUrl string
+	account      string
+	serviceID    string
+	hostID       string
+	tokenFile    string
+	tokenEnv     string
+
+	httpClient *http.Client
+}
+
+func newJwtAuthenticator(log lager.Logger, applianceUrl, account, serviceID, hostID, tokenFile, tokenEnv, certFile string) (*jwtAuthenticator, error) {
+	httpClient, err := httpClientForCertFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwtAuthenticator{
+		log:          log,
+		applianceUrl: applianceUrl,
+		account:      account,
+		serviceID:    serviceID,
+		hostID:       hostID,
+		tokenFile:    tokenFile,
+		tokenEnv:     tokenEnv,
+		httpClient:   httpClient,
+	}, nil
+}
+
+func (a *jwtAuthenticator) loadJwt() (string, error) {
+	if a.tokenFile != "" {
+		jwt, err := ioutil.ReadFile(a.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("could not read authn-jwt token file %s: %w", a.tokenFile, err)
+		}
+		return strings.TrimSpace(string(jwt)), nil
+	}
+
+	if a.tokenEnv != "" {
+		jwt := os.Getenv(a.tokenEnv)
+		if jwt == "" {
+			return "", fmt.Errorf("authn-jwt token env %s is empty", a.tokenEnv)
+		}
+		return strings.TrimSpace(jwt), nil
+	}
+
+	return "", errors.New("must provide either authn-jwt-token-file or authn-jwt-token-env")
+}
+
+func (a *jwtAuthenticator) authenticate() ([]byte, error) {
+	jwt, err := a.loadJwt()
+	if err != nil {
+		a.log.Error("load-jwt", err)
+		return nil, err
+	}
+
+	form := url.Values{"jwt": {jwt}}
+	if a.hostID != "" {
+		form.Set("host", a.hostID)
+	}
+
+	endpoint := fmt.Sprintf("%s/authn-jwt/%s/%s/authenticate", a.applianceUrl, a.serviceID, a.account)
+
+	resp, err := a.httpClient.PostForm(endpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authn-jwt authenticate failed: %s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
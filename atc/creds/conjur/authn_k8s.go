@@ -0,0 +1,195 @@
+package conjur
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// httpClientForCertFile builds an *http.Client trusting the given PEM cert
+// file in addition to the system root pool, mirroring the certificate
+// handling conjurapi.LoadConfig does for the api-key flow.
+func httpClientForCertFile(certFile string) (*http.Client, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if certFile != "" {
+		certPEM, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(certPEM) {
+			return nil, fmt.Errorf("could not append conjur cert file %s to pool", certFile)
+		}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: pool,
+			},
+		},
+	}, nil
+}
+
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// k8sAuthenticator implements tokenAuthenticator using the authn-k8s mutual
+// authentication flow: it presents the pod's service account token to obtain
+// a short-lived client certificate, then uses that certificate to exchange
+// for a Conjur access token.
+type k8sAuthenticator struct {
+	log             lager.Logger
+	applianceUrl    string
+	account         string
+	authenticatorID string
+	hostID          string
+	certFile        string
+
+	httpClient *http.Client
+}
+
+func newK8sAuthenticator(log lager.Logger, applianceUrl, account, authenticatorID, hostID, certFile string) (*k8sAuthenticator, error) {
+	httpClient, err := httpClientForCertFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &k8sAuthenticator{
+		log:             log,
+		applianceUrl:    applianceUrl,
+		account:         account,
+		authenticatorID: authenticatorID,
+		hostID:          hostID,
+		certFile:        certFile,
+		httpClient:      httpClient,
+	}, nil
+}
+
+func (a *k8sAuthenticator) authenticate() ([]byte, error) {
+	saToken, err := ioutil.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		a.log.Error("read-service-account-token", err)
+		return nil, err
+	}
+
+	key, csrPEM, err := generateCSR(a.hostID)
+	if err != nil {
+		a.log.Error("generate-csr", err)
+		return nil, err
+	}
+
+	clientCertPEM, err := a.injectClientCert(csrPEM, saToken)
+	if err != nil {
+		a.log.Error("inject-client-cert", err)
+		return nil, err
+	}
+
+	return a.authenticateWithCert(key, clientCertPEM)
+}
+
+// injectClientCert presents the CSR and service account token to the
+// authenticator's /inject_client_cert endpoint and returns the signed
+// client certificate in PEM form.
+func (a *k8sAuthenticator) injectClientCert(csrPEM, saToken []byte) ([]byte, error) {
+	url := fmt.Sprintf("%s/inject_client_cert/%s/%s", a.applianceUrl, a.authenticatorID, a.account)
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(csrPEM))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-pem-file")
+	req.Header.Set("Authorization", "Token token=\""+string(saToken)+"\"")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("inject_client_cert failed: %s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
+
+// authenticateWithCert presents the client certificate obtained above to
+// /authenticate and returns the resulting short-lived access token.
+func (a *k8sAuthenticator) authenticateWithCert(key *rsa.PrivateKey, clientCertPEM []byte) ([]byte, error) {
+	cert, err := tls.X509KeyPair(clientCertPEM, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: cert2Slice(cert),
+				RootCAs:      a.httpClient.Transport.(*http.Transport).TLSClientConfig.RootCAs,
+			},
+		},
+	}
+
+	url := fmt.Sprintf("%s/authenticate/%s/%s/%s", a.applianceUrl, a.authenticatorID, a.account, a.hostID)
+
+	resp, err := client.Post(url, "text/plain", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("authenticate failed: %s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
+
+func cert2Slice(cert tls.Certificate) []tls.Certificate {
+	return []tls.Certificate{cert}
+}
+
+func generateCSR(hostID string) (*rsa.PrivateKey, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: hostID,
+		},
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+
+	return key, csrPEM, nil
+}
@@ -0,0 +1,91 @@
+package conjur
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// tokenAuthenticator knows how to produce a fresh Conjur access token. It is
+// implemented by each of the alternative authentication modes (k8s, jwt) so
+// that they can share the same background refresh loop.
+type tokenAuthenticator interface {
+	authenticate() ([]byte, error)
+}
+
+// tokenRefresher is an ifrit.Runner that keeps a Conjur access token on disk
+// up to date by periodically invoking a tokenAuthenticator and writing its
+// result to tokenPath. conjurapi.NewClientFromTokenFile reads from the same
+// path, so the client always sees a live token without ATC needing to know
+// how it was obtained.
+type tokenRefresher struct {
+	log             lager.Logger
+	authenticator   tokenAuthenticator
+	tokenPath       string
+	refreshInterval time.Duration
+
+	mu              sync.Mutex
+	lastRefreshedAt time.Time
+}
+
+// LastRefreshedAt reports when the token was last successfully refreshed, for
+// health reporting. The zero time is returned if no refresh has succeeded yet.
+func (r *tokenRefresher) LastRefreshedAt() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastRefreshedAt
+}
+
+// NextRefreshIn reports how long until one refresh interval has passed since
+// the last successful refresh, or zero if that time has already passed (as it
+// has after a failed refresh, or before any refresh has succeeded).
+func (r *tokenRefresher) NextRefreshIn() time.Duration {
+	next := r.LastRefreshedAt().Add(r.refreshInterval).Sub(time.Now())
+	if next < 0 {
+		return 0
+	}
+	return next
+}
+
+func (r *tokenRefresher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	if err := r.refresh(); err != nil {
+		return err
+	}
+
+	close(ready)
+
+	ticker := time.NewTicker(r.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.refresh(); err != nil {
+				r.log.Error("refresh-conjur-token", err)
+			}
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func (r *tokenRefresher) refresh() error {
+	token, err := r.authenticator.authenticate()
+	if err != nil {
+		r.log.Error("authenticate-conjur", err)
+		return err
+	}
+
+	if err := ioutil.WriteFile(r.tokenPath, token, 0600); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.lastRefreshedAt = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
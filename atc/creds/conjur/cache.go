@@ -0,0 +1,283 @@
+package conjur
+
+import (
+	"bytes"
+	"container/list"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/concourse/concourse/atc/creds"
+	"github.com/cyberark/conjur-api-go/conjurapi"
+)
+
+// secretCacheEntry is what's stored per cached lookup. found distinguishes a
+// cached miss (negative cache) from a cached hit with a nil value.
+type secretCacheEntry struct {
+	key       string
+	value     interface{}
+	expiresAt *time.Time
+	found     bool
+	cachedAt  time.Time
+	negative  bool
+}
+
+func (entry *secretCacheEntry) expired(now time.Time, ttl, negativeTTL time.Duration) bool {
+	age := now.Sub(entry.cachedAt)
+	if entry.negative {
+		return age >= negativeTTL
+	}
+	return age >= ttl
+}
+
+// secretCache is a bounded, TTL'd, LRU cache of resolved Conjur secrets,
+// shared across every Secrets value the factory hands out. It exists to
+// avoid a fresh Conjur API call per ((var)) reference on every pipeline
+// check/build, which otherwise causes a thundering herd against Conjur
+// during large reconfigures.
+type secretCache struct {
+	log lager.Logger
+
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front = most recently used
+}
+
+func newSecretCache(log lager.Logger, ttl, negativeTTL time.Duration, maxEntries int) *secretCache {
+	return &secretCache{
+		log:         log,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		maxEntries:  maxEntries,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+func (cache *secretCache) get(key string) (value interface{}, expiresAt *time.Time, found bool, ok bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	elem, present := cache.entries[key]
+	if !present {
+		return nil, nil, false, false
+	}
+
+	entry := elem.Value.(*secretCacheEntry)
+	if entry.expired(time.Now(), cache.ttl, cache.negativeTTL) {
+		cache.removeLocked(elem)
+		return nil, nil, false, false
+	}
+
+	cache.order.MoveToFront(elem)
+
+	return entry.value, entry.expiresAt, entry.found, true
+}
+
+func (cache *secretCache) set(key string, value interface{}, expiresAt *time.Time, found bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry := &secretCacheEntry{
+		key:       key,
+		value:     value,
+		expiresAt: expiresAt,
+		found:     found,
+		negative:  !found,
+		cachedAt:  time.Now(),
+	}
+
+	if elem, present := cache.entries[key]; present {
+		elem.Value = entry
+		cache.order.MoveToFront(elem)
+		return
+	}
+
+	elem := cache.order.PushFront(entry)
+	cache.entries[key] = elem
+
+	for cache.maxEntries > 0 && cache.order.Len() > cache.maxEntries {
+		oldest := cache.order.Back()
+		if oldest == nil {
+			break
+		}
+		cache.removeLocked(oldest)
+	}
+}
+
+func (cache *secretCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*secretCacheEntry)
+	delete(cache.entries, entry.key)
+	cache.order.Remove(elem)
+}
+
+// purgeAffix removes every cached entry whose rendered secret path starts
+// with prefix and ends with suffix - the constant text surrounding the
+// {{.Secret}} placeholder once a secret template has been rendered for one
+// team/pipeline. Matching on both affixes (rather than a hardcoded path
+// shape) lets this work for whatever PipelineSecretTemplate/TeamSecretTemplate
+// the operator configured, not just the default one.
+func (cache *secretCache) purgeAffix(prefix, suffix string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for key, elem := range cache.entries {
+		if strings.HasPrefix(key, prefix) && strings.HasSuffix(key, suffix) {
+			cache.removeLocked(elem)
+		}
+	}
+}
+
+// purgePlaceholder is substituted for the Secret field when rendering a
+// template to recover the constant prefix/suffix text around it - chosen to
+// be vanishingly unlikely to collide with real template output.
+const purgePlaceholder = "\x00concourse-conjur-purge-placeholder\x00"
+
+// templateAffixes renders tmpl with the given team/pipeline and a unique
+// placeholder standing in for the secret name, then splits the result
+// around that placeholder. Every real secret path rendered from the same
+// template with the same team/pipeline will share this prefix and suffix,
+// regardless of the template's shape.
+func templateAffixes(tmpl *template.Template, team, pipeline string) (prefix, suffix string, err error) {
+	var buf bytes.Buffer
+	data := Secret{Team: team, Pipeline: pipeline, Secret: purgePlaceholder}
+	if err := tmpl.Execute(&buf, &data); err != nil {
+		return "", "", err
+	}
+
+	rendered := buf.String()
+	idx := strings.Index(rendered, purgePlaceholder)
+	if idx < 0 {
+		return rendered, "", nil
+	}
+
+	return rendered[:idx], rendered[idx+len(purgePlaceholder):], nil
+}
+
+// cachingSecretsFactory wraps a creds.SecretsFactory, inserting a shared
+// secretCache in front of every Secrets it hands out. It also exposes Batch,
+// so callers that know a pipeline's full var set up front can prefetch them
+// with a single RetrieveBatchSecrets call instead of N serial GETs.
+type cachingSecretsFactory struct {
+	log    lager.Logger
+	client *conjurapi.Client
+	inner  creds.SecretsFactory
+	cache  *secretCache
+
+	pipelineSecretTemplate *template.Template
+	teamSecretTemplate     *template.Template
+}
+
+func newCachingSecretsFactory(log lager.Logger, client *conjurapi.Client, inner creds.SecretsFactory, pipelineSecretTemplate, teamSecretTemplate *template.Template, ttl, negativeTTL time.Duration, maxEntries int) *cachingSecretsFactory {
+	return &cachingSecretsFactory{
+		log:                    log,
+		client:                 client,
+		inner:                  inner,
+		cache:                  newSecretCache(log.Session("secret-cache"), ttl, negativeTTL, maxEntries),
+		pipelineSecretTemplate: pipelineSecretTemplate,
+		teamSecretTemplate:     teamSecretTemplate,
+	}
+}
+
+func (factory *cachingSecretsFactory) NewSecrets() creds.Secrets {
+	return &cachingSecrets{
+		inner: factory.inner.NewSecrets(),
+		cache: factory.cache,
+	}
+}
+
+// renderPath applies tmpl to render the final Conjur secret path for one
+// var lookup, exactly as the underlying Conjur Secrets implementation does,
+// so Batch can populate the cache under the same keys Get will later use.
+func renderPath(tmpl *template.Template, team, pipeline, secret string) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &Secret{Team: team, Pipeline: pipeline, Secret: secret}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Batch prefetches every named secret for one team/pipeline with a single
+// conjurapi.RetrieveBatchSecrets call against the pipeline-scoped template,
+// and populates the cache with the results, including negative entries for
+// names Conjur did not return. Call this once a pipeline's full var set is
+// known, instead of letting each var resolve with its own serial GET.
+func (factory *cachingSecretsFactory) Batch(team, pipeline string, secretNames []string) error {
+	if len(secretNames) == 0 {
+		return nil
+	}
+
+	paths := make([]string, len(secretNames))
+	for i, name := range secretNames {
+		path, err := renderPath(factory.pipelineSecretTemplate, team, pipeline, name)
+		if err != nil {
+			factory.log.Error("render-secret-path", err)
+			return err
+		}
+		paths[i] = path
+	}
+
+	values, err := factory.client.RetrieveBatchSecrets(paths)
+	if err != nil {
+		factory.log.Error("retrieve-batch-secrets", err)
+		return err
+	}
+
+	for _, path := range paths {
+		if value, found := values[path]; found {
+			factory.cache.set(path, string(value), nil, true)
+		} else {
+			factory.cache.set(path, nil, nil, false)
+		}
+	}
+
+	return nil
+}
+
+// Purge evicts every cached entry for the given team/pipeline, so that a
+// rotated secret is picked up deterministically rather than waiting out the
+// TTL. With a pipeline given, this purges that pipeline's secrets; with
+// pipeline == "", it purges every entry matching the team template's affixes
+// for that team, which with the default templates also covers all of the
+// team's pipeline-scoped entries, since they share the team's prefix.
+func (factory *cachingSecretsFactory) Purge(team, pipeline string) {
+	tmpl := factory.teamSecretTemplate
+	if pipeline != "" {
+		tmpl = factory.pipelineSecretTemplate
+	}
+
+	prefix, suffix, err := templateAffixes(tmpl, team, pipeline)
+	if err != nil {
+		factory.log.Error("render-purge-template", err)
+		return
+	}
+
+	factory.cache.purgeAffix(prefix, suffix)
+}
+
+type cachingSecrets struct {
+	inner creds.Secrets
+	cache *secretCache
+}
+
+func (secrets *cachingSecrets) Get(path string) (interface{}, *time.Time, bool, error) {
+	if value, expiresAt, found, ok := secrets.cache.get(path); ok {
+		return value, expiresAt, found, nil
+	}
+
+	value, expiresAt, found, err := secrets.inner.Get(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	secrets.cache.set(path, value, expiresAt, found)
+
+	return value, expiresAt, found, nil
+}
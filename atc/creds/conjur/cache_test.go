@@ -0,0 +1,164 @@
+package conjur
+
+import (
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+)
+
+func TestSecretCacheEntryExpired(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name        string
+		negative    bool
+		age         time.Duration
+		ttl         time.Duration
+		negativeTTL time.Duration
+		expired     bool
+	}{
+		{"positive entry within ttl", false, time.Second, time.Minute, time.Minute, false},
+		{"positive entry past ttl", false, 2 * time.Minute, time.Minute, time.Minute, true},
+		{"negative entry within negativeTTL", true, time.Second, time.Minute, time.Minute, false},
+		{"negative entry past negativeTTL", true, 2 * time.Minute, time.Second, time.Second, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			entry := &secretCacheEntry{
+				negative: c.negative,
+				cachedAt: now.Add(-c.age),
+			}
+
+			if got := entry.expired(now, c.ttl, c.negativeTTL); got != c.expired {
+				t.Errorf("expired(%s, %s, %s) = %v, want %v", c.age, c.ttl, c.negativeTTL, got, c.expired)
+			}
+		})
+	}
+}
+
+func TestSecretCacheGetSet(t *testing.T) {
+	cache := newSecretCache(lagertest.NewTestLogger("cache"), time.Minute, time.Minute, 0)
+
+	if _, _, _, ok := cache.get("/concourse/team/pipeline/secret"); ok {
+		t.Fatalf("expected miss on empty cache")
+	}
+
+	cache.set("/concourse/team/pipeline/secret", "value", nil, true)
+
+	value, _, found, ok := cache.get("/concourse/team/pipeline/secret")
+	if !ok || !found || value != "value" {
+		t.Fatalf("get() = (%v, _, %v, %v), want (value, _, true, true)", value, found, ok)
+	}
+
+	cache.set("/concourse/team/pipeline/missing", nil, nil, false)
+
+	_, _, found, ok = cache.get("/concourse/team/pipeline/missing")
+	if !ok || found {
+		t.Fatalf("expected a cached negative (miss) entry, got found=%v ok=%v", found, ok)
+	}
+}
+
+func TestSecretCacheGetExpired(t *testing.T) {
+	cache := newSecretCache(lagertest.NewTestLogger("cache"), time.Millisecond, time.Millisecond, 0)
+	cache.set("/concourse/team/pipeline/secret", "value", nil, true)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, _, _, ok := cache.get("/concourse/team/pipeline/secret"); ok {
+		t.Fatalf("expected expired entry to be evicted on get")
+	}
+}
+
+func TestSecretCacheMaxEntriesEvictsLRU(t *testing.T) {
+	cache := newSecretCache(lagertest.NewTestLogger("cache"), time.Minute, time.Minute, 2)
+
+	cache.set("a", "1", nil, true)
+	cache.set("b", "2", nil, true)
+
+	// touch "a" so "b" becomes the least recently used entry
+	cache.get("a")
+
+	cache.set("c", "3", nil, true)
+
+	if _, _, _, ok := cache.get("b"); ok {
+		t.Fatalf("expected least recently used entry to be evicted")
+	}
+	if _, _, _, ok := cache.get("a"); !ok {
+		t.Fatalf("expected recently used entry to survive eviction")
+	}
+	if _, _, _, ok := cache.get("c"); !ok {
+		t.Fatalf("expected newly inserted entry to be present")
+	}
+}
+
+func TestSecretCachePurgeAffix(t *testing.T) {
+	cache := newSecretCache(lagertest.NewTestLogger("cache"), time.Minute, time.Minute, 0)
+
+	cache.set("/concourse/team-a/pipeline/secret-1", "1", nil, true)
+	cache.set("/concourse/team-a/pipeline/secret-2", "2", nil, true)
+	cache.set("/concourse/team-b/pipeline/secret-1", "3", nil, true)
+
+	cache.purgeAffix("/concourse/team-a/pipeline/", "")
+
+	if _, _, _, ok := cache.get("/concourse/team-a/pipeline/secret-1"); ok {
+		t.Errorf("expected team-a entry to be purged")
+	}
+	if _, _, _, ok := cache.get("/concourse/team-a/pipeline/secret-2"); ok {
+		t.Errorf("expected team-a entry to be purged")
+	}
+	if _, _, _, ok := cache.get("/concourse/team-b/pipeline/secret-1"); !ok {
+		t.Errorf("expected team-b entry to survive an unrelated team's purge")
+	}
+}
+
+func TestTemplateAffixes(t *testing.T) {
+	tmpl, err := buildSecretTemplate("pipeline-secret-template", DefaultPipelineSecretTemplate)
+	if err != nil {
+		t.Fatalf("buildSecretTemplate: %v", err)
+	}
+
+	prefix, suffix, err := templateAffixes(tmpl, "team-a", "pipeline-a")
+	if err != nil {
+		t.Fatalf("templateAffixes: %v", err)
+	}
+
+	if want := "/concourse/team-a/pipeline-a/"; prefix != want {
+		t.Errorf("prefix = %q, want %q", prefix, want)
+	}
+	if suffix != "" {
+		t.Errorf("suffix = %q, want empty string for a template ending in {{.Secret}}", suffix)
+	}
+
+	rendered, err := renderPath(tmpl, "team-a", "pipeline-a", "my-secret")
+	if err != nil {
+		t.Fatalf("renderPath: %v", err)
+	}
+	if !startsWithAndEndsWith(rendered, prefix, suffix) {
+		t.Errorf("rendered path %q does not match affixes (%q, %q)", rendered, prefix, suffix)
+	}
+}
+
+func TestTemplateAffixesCustomTemplate(t *testing.T) {
+	tmpl, err := buildSecretTemplate("custom", "/custom/{{.Team}}/{{.Secret}}/{{.Pipeline}}-suffix")
+	if err != nil {
+		t.Fatalf("buildSecretTemplate: %v", err)
+	}
+
+	prefix, suffix, err := templateAffixes(tmpl, "team-a", "pipeline-a")
+	if err != nil {
+		t.Fatalf("templateAffixes: %v", err)
+	}
+
+	if want := "/custom/team-a/"; prefix != want {
+		t.Errorf("prefix = %q, want %q", prefix, want)
+	}
+	if want := "/pipeline-a-suffix"; suffix != want {
+		t.Errorf("suffix = %q, want %q", suffix, want)
+	}
+}
+
+func startsWithAndEndsWith(s, prefix, suffix string) bool {
+	return len(s) >= len(prefix)+len(suffix) && s[:len(prefix)] == prefix && s[len(s)-len(suffix):] == suffix
+}
@@ -1,12 +1,21 @@
 package conjur
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
 	"text/template/parse"
+	"time"
 
 	"code.cloudfoundry.org/lager"
+	"github.com/tedsuo/ifrit"
 
 	"github.com/concourse/concourse/atc/creds"
 	"github.com/cyberark/conjur-api-go/conjurapi"
@@ -16,15 +25,57 @@ import (
 const DefaultPipelineSecretTemplate = "/concourse/{{.Team}}/{{.Pipeline}}/{{.Secret}}"
 const DefaultTeamSecretTemplate = "/concourse/{{.Team}}/{{.Secret}}"
 
+func init() {
+	creds.ManagerFactories["conjur"] = func() creds.Manager {
+		return &Manager{}
+	}
+}
+
 type Manager struct {
-	ConjurApplianceUrl     string `long:"appliance-url" description:"URL of the conjur instance"`
-	ConjurAccount          string `long:"account" description:"Conjur Account"`
-	ConjurCertFile         string `long:"cert-file" description:"Cert file used if conjur instance is using a self signed cert. E.g. /path/to/conjur.pem"`
-	ConjurAuthnLogin       string `long:"authn-login" description:"Host username. E.g host/concourse"`
-	ConjurAuthnApiKey      string `long:"authn-api-key" description:"Api key related to the host"`
-	PipelineSecretTemplate string `long:"pipeline-secret-template" description:"AWS Secrets Manager secret identifier template used for pipeline specific parameter" default:"/concourse/{{.Team}}/{{.Pipeline}}/{{.Secret}}"`
-	TeamSecretTemplate     string `long:"team-secret-template" description:"AWS Secrets Manager secret identifier  template used for team specific parameter" default:"/concourse/{{.Team}}/{{.Secret}}"`
+	ConjurApplianceUrl string `long:"appliance-url" yaml:"appliance-url" description:"URL of the conjur instance"`
+	ConjurAccount      string `long:"account" yaml:"account" description:"Conjur Account"`
+	ConjurCertFile     string `long:"cert-file" yaml:"cert-file" description:"Cert file used if conjur instance is using a self signed cert. E.g. /path/to/conjur.pem"`
+	ConjurAuthnLogin   string `long:"authn-login" yaml:"authn-login" description:"Host username. E.g host/concourse"`
+	ConjurAuthnApiKey  string `long:"authn-api-key" yaml:"authn-api-key" description:"Api key related to the host"`
+
+	ConjurAuthnK8sAuthenticatorID string        `long:"authn-k8s-authenticator-id" yaml:"authn-k8s-authenticator-id" description:"Authenticator id of the authn-k8s authenticator, e.g. my-authn-k8s-service"`
+	ConjurAuthnK8sCertFile        string        `long:"authn-k8s-cert-file" yaml:"authn-k8s-cert-file" description:"Cert file used to validate the Conjur authn-k8s endpoint. E.g. /path/to/conjur.pem"`
+	ConjurAuthnK8sHostID          string        `long:"authn-k8s-host-id" yaml:"authn-k8s-host-id" description:"Host id to authenticate as, e.g host/concourse/apps/concourse-web-0"`
+	ConjurAuthnK8sRefreshInterval time.Duration `long:"authn-k8s-refresh-interval" yaml:"authn-k8s-refresh-interval" description:"How often to re-authenticate and refresh the Conjur access token" default:"6m"`
+
+	ConjurAuthnJwtServiceID       string        `long:"authn-jwt-service-id" yaml:"authn-jwt-service-id" description:"Service id of the authn-jwt authenticator, e.g. my-authn-jwt-service"`
+	ConjurAuthnJwtCertFile        string        `long:"authn-jwt-cert-file" yaml:"authn-jwt-cert-file" description:"Cert file used to validate the Conjur authn-jwt endpoint, e.g. /path/to/conjur.pem"`
+	ConjurAuthnJwtTokenFile       string        `long:"authn-jwt-token-file" yaml:"authn-jwt-token-file" description:"Path to a file containing the JWT to authenticate with, e.g. as mounted by a CI runner or workload identity provider"`
+	ConjurAuthnJwtTokenEnv        string        `long:"authn-jwt-token-env" yaml:"authn-jwt-token-env" description:"Name of an environment variable containing the JWT to authenticate with, as an alternative to authn-jwt-token-file"`
+	ConjurAuthnJwtHostID          string        `long:"authn-jwt-host-id" yaml:"authn-jwt-host-id" description:"Optional host id to authenticate as, if not derivable from the JWT claims"`
+	ConjurAuthnJwtRefreshInterval time.Duration `long:"authn-jwt-refresh-interval" yaml:"authn-jwt-refresh-interval" description:"How often to re-authenticate and refresh the Conjur access token" default:"6m"`
+
+	PipelineSecretTemplate string `long:"pipeline-secret-template" yaml:"pipeline-secret-template" description:"Conjur secret identifier template used for pipeline specific parameter" default:"/concourse/{{.Team}}/{{.Pipeline}}/{{.Secret}}"`
+	TeamSecretTemplate     string `long:"team-secret-template" yaml:"team-secret-template" description:"Conjur secret identifier  template used for team specific parameter" default:"/concourse/{{.Team}}/{{.Secret}}"`
 	Conjur                 *Conjur
+
+	CacheTTL         time.Duration `long:"cache-ttl" yaml:"cache-ttl" description:"If set, cache resolved secrets for this long before re-fetching them from Conjur" default:"0s"`
+	CacheNegativeTTL time.Duration `long:"cache-negative-ttl" yaml:"cache-negative-ttl" description:"If set, cache a secret not being found for this long before re-checking Conjur. Only takes effect when cache-ttl is also set" default:"0s"`
+	CacheMaxEntries  int           `long:"cache-max-entries" yaml:"cache-max-entries" description:"Maximum number of resolved secrets to keep in the cache" default:"10000"`
+
+	refresher      *tokenRefresher
+	cachingFactory *cachingSecretsFactory
+}
+
+// cacheEnabled reports whether the in-process secret cache introduced to
+// avoid a fresh Conjur call per ((var)) reference is switched on. It
+// defaults off so existing deployments see no behavior change.
+func (manager *Manager) cacheEnabled() bool {
+	return manager.CacheTTL > 0
+}
+
+// Purge evicts every cached secret for the given team/pipeline. It's meant
+// to be wired into the pipeline-save code path so that a fly set-pipeline or
+// pause-pipeline deterministically picks up rotated secrets.
+func (manager *Manager) Purge(team, pipeline string) {
+	if manager.cachingFactory != nil {
+		manager.cachingFactory.Purge(team, pipeline)
+	}
 }
 
 type Secret struct {
@@ -44,47 +95,315 @@ func buildSecretTemplate(name, tmpl string) (*template.Template, error) {
 	return t, nil
 }
 
-func (manager *Manager) Init(log lager.Logger) error {
+// usesAuthnK8s reports whether the manager is configured to authenticate
+// via the authn-k8s mutual authentication flow rather than a static API key.
+func (manager *Manager) usesAuthnK8s() bool {
+	return manager.ConjurAuthnK8sAuthenticatorID != ""
+}
+
+// usesAuthnJwt reports whether the manager is configured to authenticate
+// via the authn-jwt federated identity flow rather than a static API key.
+func (manager *Manager) usesAuthnJwt() bool {
+	return manager.ConjurAuthnJwtServiceID != ""
+}
+
+// instanceID derives a short, filesystem-safe identifier unique to this
+// manager's configured Conjur endpoint and authenticator identity. A
+// --credential-managers-file chain can instantiate more than one
+// conjur.Manager in the same ATC process (two Conjur instances, or a
+// primary plus a DR instance), so the k8s/jwt token files can't share a
+// single hardcoded name - two refreshers writing to the same path would
+// each read back whichever one last won the race, handing one provider's
+// access token to the other's client.
+func (manager *Manager) instanceID() string {
+	h := sha256.Sum256([]byte(manager.ConjurApplianceUrl + "|" + manager.ConjurAccount + "|" +
+		manager.ConjurAuthnK8sAuthenticatorID + "|" + manager.ConjurAuthnK8sHostID + "|" +
+		manager.ConjurAuthnJwtServiceID + "|" + manager.ConjurAuthnJwtHostID))
+	return hex.EncodeToString(h[:])[:16]
+}
+
+// k8sTokenFile is where the background refresher writes the current Conjur
+// access token, for conjurapi.NewClientFromTokenFile to pick up.
+func (manager *Manager) k8sTokenFile() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("conjur-authn-k8s-access-token-%s", manager.instanceID()))
+}
+
+// jwtTokenFile is where the background refresher writes the current Conjur
+// access token, for conjurapi.NewClientFromTokenFile to pick up. Suffixed by
+// instanceID for the same reason as k8sTokenFile: more than one
+// conjur.Manager can run in the same ATC process via a
+// --credential-managers-file chain, and they must not clobber each other's
+// token file.
+func (manager *Manager) jwtTokenFile() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("conjur-authn-jwt-access-token-%s", manager.instanceID()))
+}
+
+// newK8sTokenRefresher builds the authn-k8s refresher and performs one
+// synchronous authentication so the token file (and thus the client built
+// from it) is usable as soon as Init returns. It does not invoke the
+// refresher itself — the returned runner is meant to be added to ATC's own
+// ifrit process group by the command that owns the process's signal
+// handling, so the refresh loop actually stops on a real shutdown signal
+// instead of running as an orphaned, unsupervised goroutine.
+func (manager *Manager) newK8sTokenRefresher(log lager.Logger) (*tokenRefresher, error) {
+	authenticator, err := newK8sAuthenticator(
+		log.Session("authn-k8s"),
+		manager.ConjurApplianceUrl,
+		manager.ConjurAccount,
+		manager.ConjurAuthnK8sAuthenticatorID,
+		manager.ConjurAuthnK8sHostID,
+		manager.ConjurAuthnK8sCertFile,
+	)
+	if err != nil {
+		log.Error("create-authn-k8s-authenticator", err)
+		return nil, err
+	}
+
+	refresher := &tokenRefresher{
+		log:             log.Session("authn-k8s-refresher"),
+		authenticator:   authenticator,
+		tokenPath:       manager.k8sTokenFile(),
+		refreshInterval: manager.ConjurAuthnK8sRefreshInterval,
+	}
+
+	if err := refresher.refresh(); err != nil {
+		return nil, err
+	}
+
+	return refresher, nil
+}
+
+// newJwtTokenRefresher is the authn-jwt analog of newK8sTokenRefresher.
+func (manager *Manager) newJwtTokenRefresher(log lager.Logger) (*tokenRefresher, error) {
+	authenticator, err := newJwtAuthenticator(
+		log.Session("authn-jwt"),
+		manager.ConjurApplianceUrl,
+		manager.ConjurAccount,
+		manager.ConjurAuthnJwtServiceID,
+		manager.ConjurAuthnJwtHostID,
+		manager.ConjurAuthnJwtTokenFile,
+		manager.ConjurAuthnJwtTokenEnv,
+		manager.ConjurAuthnJwtCertFile,
+	)
+	if err != nil {
+		log.Error("create-authn-jwt-authenticator", err)
+		return nil, err
+	}
+
+	refresher := &tokenRefresher{
+		log:             log.Session("authn-jwt-refresher"),
+		authenticator:   authenticator,
+		tokenPath:       manager.jwtTokenFile(),
+		refreshInterval: manager.ConjurAuthnJwtRefreshInterval,
+	}
+
+	if err := refresher.refresh(); err != nil {
+		return nil, err
+	}
+
+	return refresher, nil
+}
+
+// Runner returns the ifrit.Runner that keeps the k8s/JWT access token
+// refreshed. It returns false if the manager is using static api-key
+// authentication, which needs no refresher. This satisfies creds.Runnable,
+// so the ATC command picks it up via creds.Runners/ChainManager.Runners and
+// adds it to its own ifrit process group, rather than calling it directly.
+func (manager *Manager) Runner() (ifrit.Runner, bool) {
+	return manager.refresher, manager.refresher != nil
+}
+
+// conjurClient builds (on first call) or returns the already-built Conjur
+// client. It is called from both Init and NewSecretsFactory, which must
+// share a single client and a single token refresher rather than each
+// standing up their own — constructing it twice would leak a second,
+// unsupervised refresher hitting Conjur's authenticate endpoint forever.
+func (manager *Manager) conjurClient(log lager.Logger) (*conjurapi.Client, error) {
+	if manager.Conjur != nil && manager.Conjur.client != nil {
+		return manager.Conjur.client, nil
+	}
 
 	config, err := conjurapi.LoadConfig()
 	if err != nil {
 		log.Error("load-conjur-config", err)
-		return err
+		return nil, err
 	}
 	config.ApplianceURL = manager.ConjurApplianceUrl
 	config.Account = manager.ConjurAccount
 
-	conjur, err := conjurapi.NewClientFromKey(config,
-		authn.LoginPair{
-			Login:  manager.ConjurAuthnLogin,
-			APIKey: manager.ConjurAuthnApiKey,
-		},
-	)
-	if err != nil {
-		log.Error("create-conjur-api-instance", err)
-		return err
+	var client *conjurapi.Client
+
+	switch {
+	case manager.usesAuthnK8s():
+		refresher, err := manager.newK8sTokenRefresher(log)
+		if err != nil {
+			return nil, err
+		}
+		manager.refresher = refresher
+
+		client, err = conjurapi.NewClientFromTokenFile(config, manager.k8sTokenFile())
+		if err != nil {
+			return nil, err
+		}
+
+	case manager.usesAuthnJwt():
+		refresher, err := manager.newJwtTokenRefresher(log)
+		if err != nil {
+			return nil, err
+		}
+		manager.refresher = refresher
+
+		client, err = conjurapi.NewClientFromTokenFile(config, manager.jwtTokenFile())
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		client, err = conjurapi.NewClientFromKey(config,
+			authn.LoginPair{
+				Login:  manager.ConjurAuthnLogin,
+				APIKey: manager.ConjurAuthnApiKey,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	manager.Conjur = &Conjur{
 		log:    log,
-		client: conjur,
+		client: client,
+	}
+
+	return client, nil
+}
+
+func (manager *Manager) Init(log lager.Logger) error {
+
+	_, err := manager.conjurClient(log)
+	if err != nil {
+		log.Error("create-conjur-api-instance", err)
+		return err
 	}
 
 	return nil
 }
 
+// authenticatorType reports which authentication mode is active, for
+// health reporting.
+func (manager *Manager) authenticatorType() string {
+	switch {
+	case manager.usesAuthnK8s():
+		return "k8s"
+	case manager.usesAuthnJwt():
+		return "jwt"
+	default:
+		return "api-key"
+	}
+}
+
+// healthCheckTimeout bounds each probe a Health() call makes (WhoAmI, then
+// the /health fallback if WhoAmI fails), so a single Health() call blocks for
+// at most about twice this on a slow or half-dead appliance.
+// ChainManager.CredentialManagerInfos
+// calls Health() synchronously per configured provider on every hit to the
+// (frequently polled) info endpoint, so an unbounded call here would let one
+// unreachable Conjur instance stall that endpoint for every caller.
+const healthCheckTimeout = 5 * time.Second
+
 func (manager *Manager) Health() (*creds.HealthResponse, error) {
 	health := &creds.HealthResponse{
-		Method: "GetSecretValue",
+		Method: "WhoAmI",
+	}
+
+	response := map[string]string{
+		"authenticator": manager.authenticatorType(),
 	}
 
-	health.Response = map[string]string{
-		"status": "UP",
+	if manager.Conjur == nil || manager.Conjur.client == nil {
+		response["status"] = "DOWN"
+		response["error"] = "conjur client not initialized"
+		health.Response = response
+		return health, nil
 	}
 
+	start := time.Now()
+	err := manager.whoAmIWithTimeout(healthCheckTimeout)
+	latency := time.Since(start)
+
+	switch {
+	case err == nil:
+		response["status"] = "UP"
+		response["latency"] = latency.String()
+
+	default:
+		// WhoAmI isn't available on every appliance version (older Conjur
+		// instances, and some authn-k8s-only hosts, don't implement it), so
+		// before calling the provider DOWN, fall back to an unauthenticated
+		// GET against the appliance's own /health endpoint.
+		if healthErr := manager.applianceHealth(healthCheckTimeout); healthErr == nil {
+			health.Method = "appliance-health"
+			response["status"] = "UP"
+		} else {
+			response["status"] = "DOWN"
+			response["error"] = err.Error()
+		}
+	}
+
+	if manager.refresher != nil {
+		if lastRefreshedAt := manager.refresher.LastRefreshedAt(); !lastRefreshedAt.IsZero() {
+			response["last_authenticated_at"] = lastRefreshedAt.Format(time.RFC3339)
+			response["next_refresh_in"] = manager.refresher.NextRefreshIn().String()
+		}
+	}
+
+	health.Response = response
+
 	return health, nil
 }
 
+// whoAmIWithTimeout calls WhoAmI with a deadline. conjurapi.Client.WhoAmI
+// takes no context, so the call is run on a goroutine and raced against a
+// timer; a hung call leaks that one goroutine rather than blocking Health.
+func (manager *Manager) whoAmIWithTimeout(timeout time.Duration) error {
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := manager.Conjur.client.WhoAmI()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("who-am-i check timed out after %s", timeout)
+	}
+}
+
+// applianceHealth does a lightweight, unauthenticated GET against the
+// appliance's own /health endpoint, as a fallback health signal for
+// appliances that don't support WhoAmI.
+func (manager *Manager) applianceHealth(timeout time.Duration) error {
+	client, err := httpClientForCertFile(manager.ConjurCertFile)
+	if err != nil {
+		return err
+	}
+	client.Timeout = timeout
+
+	resp, err := client.Get(strings.TrimRight(manager.ConjurApplianceUrl, "/") + "/health")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("appliance health check failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
 func (manager *Manager) IsConfigured() bool {
 	return manager.ConjurApplianceUrl != ""
 }
@@ -111,16 +430,50 @@ func (manager *Manager) Validate() error {
 
 	// All of the AWS credential variables may be empty since credentials may be obtained via environemnt variables
 	// or other means. However, if one of them is provided, then all of them (except session token) must be provided.
-	if manager.ConjurApplianceUrl == "" && manager.ConjurAccount == "" && manager.ConjurAuthnLogin == "" && manager.ConjurAuthnApiKey == "" {
+	if manager.ConjurApplianceUrl == "" && manager.ConjurAccount == "" && manager.ConjurAuthnLogin == "" &&
+		manager.ConjurAuthnApiKey == "" && !manager.usesAuthnK8s() && !manager.usesAuthnJwt() {
 		return nil
 	}
 
-	if manager.ConjurAuthnLogin == "" {
-		return errors.New("must provide conjur authn login")
+	authnModes := 0
+	if manager.usesAuthnK8s() {
+		authnModes++
+	}
+	if manager.usesAuthnJwt() {
+		authnModes++
+	}
+	if manager.ConjurAuthnLogin != "" || manager.ConjurAuthnApiKey != "" {
+		authnModes++
 	}
+	if authnModes > 1 {
+		return errors.New("authn-k8s, authn-jwt and authn-login/authn-api-key are mutually exclusive")
+	}
+
+	switch {
+	case manager.usesAuthnK8s():
+		if manager.ConjurAuthnK8sHostID == "" {
+			return errors.New("must provide conjur authn-k8s host id")
+		}
+
+	case manager.usesAuthnJwt():
+		if manager.ConjurAuthnJwtTokenFile == "" && manager.ConjurAuthnJwtTokenEnv == "" {
+			return errors.New("must provide one of authn-jwt-token-file or authn-jwt-token-env")
+		}
 
-	if manager.ConjurAuthnApiKey == "" {
-		return errors.New("must provide conjur authn key")
+		if manager.ConjurAuthnJwtTokenFile != "" {
+			if _, err := os.Stat(manager.ConjurAuthnJwtTokenFile); err != nil {
+				return fmt.Errorf("authn-jwt-token-file %s is not accessible: %w", manager.ConjurAuthnJwtTokenFile, err)
+			}
+		}
+
+	default:
+		if manager.ConjurAuthnLogin == "" {
+			return errors.New("must provide conjur authn login")
+		}
+
+		if manager.ConjurAuthnApiKey == "" {
+			return errors.New("must provide conjur authn key")
+		}
 	}
 
 	if manager.ConjurApplianceUrl == "" {
@@ -136,20 +489,7 @@ func (manager *Manager) Validate() error {
 
 func (manager *Manager) NewSecretsFactory(log lager.Logger) (creds.SecretsFactory, error) {
 
-	config, err := conjurapi.LoadConfig()
-	if err != nil {
-		log.Error("load-conjur-config", err)
-		return nil, err
-	}
-	config.ApplianceURL = manager.ConjurApplianceUrl
-	config.Account = manager.ConjurAccount
-
-	client, err := conjurapi.NewClientFromKey(config,
-		authn.LoginPair{
-			Login:  manager.ConjurAuthnLogin,
-			APIKey: manager.ConjurAuthnApiKey,
-		},
-	)
+	client, err := manager.conjurClient(log)
 	if err != nil {
 		log.Error("create-conjur-api-instance", err)
 		return nil, err
@@ -165,5 +505,16 @@ func (manager *Manager) NewSecretsFactory(log lager.Logger) (creds.SecretsFactor
 		return nil, err
 	}
 
-	return NewConjurFactory(log, client, []*template.Template{pipelineSecretTemplate, teamSecretTemplate}), nil
+	factory := NewConjurFactory(log, client, []*template.Template{pipelineSecretTemplate, teamSecretTemplate})
+
+	if !manager.cacheEnabled() {
+		return factory, nil
+	}
+
+	// Constructed once here and shared across every creds.Secrets the
+	// factory subsequently hands out, since NewSecretsFactory itself is
+	// only called once at ATC startup.
+	manager.cachingFactory = newCachingSecretsFactory(log, client, factory, pipelineSecretTemplate, teamSecretTemplate, manager.CacheTTL, manager.CacheNegativeTTL, manager.CacheMaxEntries)
+
+	return manager.cachingFactory, nil
 }
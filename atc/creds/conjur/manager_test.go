@@ -0,0 +1,208 @@
+package conjur
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func newTestManager() *Manager {
+	return &Manager{
+		PipelineSecretTemplate: DefaultPipelineSecretTemplate,
+		TeamSecretTemplate:     DefaultTeamSecretTemplate,
+	}
+}
+
+func TestManagerValidateUnconfiguredIsValid(t *testing.T) {
+	manager := newTestManager()
+
+	if err := manager.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil for a wholly unconfigured manager", err)
+	}
+}
+
+func TestManagerValidateApiKeyMode(t *testing.T) {
+	cases := []struct {
+		name      string
+		configure func(*Manager)
+		wantErr   bool
+	}{
+		{
+			name: "valid api-key config",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnLogin = "host/concourse"
+				m.ConjurAuthnApiKey = "key"
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing authn login",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnApiKey = "key"
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing authn api key",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnLogin = "host/concourse"
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing appliance url",
+			configure: func(m *Manager) {
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnLogin = "host/concourse"
+				m.ConjurAuthnApiKey = "key"
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing account",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAuthnLogin = "host/concourse"
+				m.ConjurAuthnApiKey = "key"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := newTestManager()
+			c.configure(manager)
+
+			err := manager.Validate()
+			if (err != nil) != c.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagerValidateAuthnK8sMode(t *testing.T) {
+	cases := []struct {
+		name      string
+		configure func(*Manager)
+		wantErr   bool
+	}{
+		{
+			name: "valid k8s config",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnK8sAuthenticatorID = "my-authn-k8s"
+				m.ConjurAuthnK8sHostID = "host/concourse/apps/web-0"
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing host id",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnK8sAuthenticatorID = "my-authn-k8s"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := newTestManager()
+			c.configure(manager)
+
+			err := manager.Validate()
+			if (err != nil) != c.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagerValidateAuthnJwtMode(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "jwt-token")
+	if err := ioutil.WriteFile(tokenFile, []byte("a-jwt"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		configure func(*Manager)
+		wantErr   bool
+	}{
+		{
+			name: "valid jwt config via token file",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnJwtServiceID = "my-authn-jwt"
+				m.ConjurAuthnJwtTokenFile = tokenFile
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid jwt config via token env",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnJwtServiceID = "my-authn-jwt"
+				m.ConjurAuthnJwtTokenEnv = "JWT_TOKEN"
+			},
+			wantErr: false,
+		},
+		{
+			name: "missing token file and env",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnJwtServiceID = "my-authn-jwt"
+			},
+			wantErr: true,
+		},
+		{
+			name: "token file does not exist",
+			configure: func(m *Manager) {
+				m.ConjurApplianceUrl = "https://conjur.example.com"
+				m.ConjurAccount = "my-account"
+				m.ConjurAuthnJwtServiceID = "my-authn-jwt"
+				m.ConjurAuthnJwtTokenFile = filepath.Join(t.TempDir(), "does-not-exist")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := newTestManager()
+			c.configure(manager)
+
+			err := manager.Validate()
+			if (err != nil) != c.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagerValidateAuthnModesAreMutuallyExclusive(t *testing.T) {
+	manager := newTestManager()
+	manager.ConjurApplianceUrl = "https://conjur.example.com"
+	manager.ConjurAccount = "my-account"
+	manager.ConjurAuthnK8sAuthenticatorID = "my-authn-k8s"
+	manager.ConjurAuthnK8sHostID = "host/concourse/apps/web-0"
+	manager.ConjurAuthnJwtServiceID = "my-authn-jwt"
+	manager.ConjurAuthnJwtTokenEnv = "JWT_TOKEN"
+
+	if err := manager.Validate(); err == nil {
+		t.Errorf("Validate() = nil, want an error since authn-k8s and authn-jwt are both configured")
+	}
+}
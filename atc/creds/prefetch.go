@@ -0,0 +1,22 @@
+package creds
+
+// BatchPrefetcher is implemented by a SecretsFactory whose underlying
+// provider supports resolving several secrets in one round trip. Not every
+// SecretsFactory can do this, so it's consulted via PrefetchIfSupported
+// rather than being part of the SecretsFactory interface itself.
+type BatchPrefetcher interface {
+	Batch(team, pipeline string, secretNames []string) error
+}
+
+// PrefetchIfSupported resolves every name in secretNames for the given
+// team/pipeline in a single round trip if factory supports it, and is a
+// no-op otherwise. Callers that already know a pipeline's full var set (e.g.
+// while checking or scheduling a pipeline) should call this unconditionally
+// rather than type asserting themselves, since most SecretsFactory
+// implementations have no batch path and resolve each var on its own.
+func PrefetchIfSupported(factory SecretsFactory, team, pipeline string, secretNames []string) error {
+	if prefetcher, ok := factory.(BatchPrefetcher); ok {
+		return prefetcher.Batch(team, pipeline, secretNames)
+	}
+	return nil
+}
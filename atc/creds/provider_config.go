@@ -0,0 +1,87 @@
+package creds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ProviderConfig describes a single credential manager entry in a
+// --credential-managers-file document: an id used for provider-pinned
+// lookups, the manager type (matching a key in the ManagerFactories
+// registry), and type-specific options.
+type ProviderConfig struct {
+	ID      string                 `json:"id" yaml:"id"`
+	Type    string                 `json:"type" yaml:"type"`
+	Options map[string]interface{} `json:"options" yaml:"options"`
+}
+
+// ManagerFactories maps a credential manager type name (as it appears in a
+// ProviderConfig's Type field) to a constructor for a fresh, zero-valued
+// Manager of that type. A creds sub-package makes its type available here by
+// registering from an init() function; only the conjur package does so, so
+// "conjur" is the only Type a --credential-managers-file entry can use.
+var ManagerFactories = map[string]func() Manager{}
+
+// LoadProviderConfigs reads and parses a --credential-managers-file document.
+// Both YAML and JSON are accepted, selected by file extension, since that
+// mirrors how pipeline configs are already loaded elsewhere in Concourse.
+func LoadProviderConfigs(path string) ([]ProviderConfig, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read credential managers file %s: %w", path, err)
+	}
+
+	var configs []ProviderConfig
+
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(bytes, &configs)
+	default:
+		err = yaml.Unmarshal(bytes, &configs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse credential managers file %s: %w", path, err)
+	}
+
+	seen := map[string]bool{}
+	for _, config := range configs {
+		if config.ID == "" {
+			return nil, fmt.Errorf("credential manager entry missing required 'id' field")
+		}
+		if seen[config.ID] {
+			return nil, fmt.Errorf("duplicate credential manager id %q", config.ID)
+		}
+		seen[config.ID] = true
+
+		if _, ok := ManagerFactories[config.Type]; !ok {
+			return nil, fmt.Errorf("unknown credential manager type %q for id %q", config.Type, config.ID)
+		}
+	}
+
+	return configs, nil
+}
+
+// buildManager instantiates and configures a Manager from its ProviderConfig
+// by round-tripping the Options map through the manager's own `yaml` struct
+// tags. Each Manager is expected to tag its fields with the same hyphenated
+// name as its `long` (CLI flag) tag, e.g. `long:"appliance-url"
+// yaml:"appliance-url"`, so that a --credential-managers-file entry's
+// `options:` keys match the documented flag names exactly.
+func buildManager(config ProviderConfig) (Manager, error) {
+	manager := ManagerFactories[config.Type]()
+
+	optsBytes, err := yaml.Marshal(config.Options)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal options for credential manager %q: %w", config.ID, err)
+	}
+
+	if err := yaml.Unmarshal(optsBytes, manager); err != nil {
+		return nil, fmt.Errorf("could not apply options for credential manager %q: %w", config.ID, err)
+	}
+
+	return manager, nil
+}
@@ -0,0 +1,21 @@
+package creds
+
+// Purger is implemented by a Manager whose SecretsFactory caches resolved
+// secrets and can selectively evict them for one team/pipeline. Not every
+// Manager caches, so this is consulted via PurgeIfSupported rather than
+// being part of the Manager interface itself.
+type Purger interface {
+	Purge(team, pipeline string)
+}
+
+// PurgeIfSupported evicts cached secrets for the given team/pipeline if
+// manager supports it, and is a no-op otherwise. It exists so that the
+// pipeline-save path (e.g. db.Team.SavePipeline / db.Pipeline.Unpause, on
+// every successful fly set-pipeline or pause/unpause) can call this
+// unconditionally right after the write commits, rather than type asserting
+// a Manager itself, since most Manager implementations don't cache.
+func PurgeIfSupported(manager Manager, team, pipeline string) {
+	if purger, ok := manager.(Purger); ok {
+		purger.Purge(team, pipeline)
+	}
+}
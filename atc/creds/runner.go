@@ -0,0 +1,37 @@
+package creds
+
+import "github.com/tedsuo/ifrit"
+
+// Runnable is implemented by a Manager whose credentials depend on a
+// long-running background process, such as Conjur's k8s/JWT access-token
+// refresher. Not every Manager needs one, so this is consulted via Runners
+// rather than being part of the Manager interface itself.
+type Runnable interface {
+	Runner() (ifrit.Runner, bool)
+}
+
+// Runners collects the background ifrit.Runner for every manager that needs
+// one. The ATC command is expected to add the result to its own ifrit
+// process group alongside its other long-running components (the API
+// server, the scheduler, ...), so each runner's signals channel is fed a
+// real OS signal on shutdown instead of running unsupervised for the life
+// of the process.
+func Runners(managers ...Manager) []ifrit.Runner {
+	var runners []ifrit.Runner
+
+	for _, manager := range managers {
+		runnable, ok := manager.(Runnable)
+		if !ok {
+			continue
+		}
+
+		runner, ok := runnable.Runner()
+		if !ok {
+			continue
+		}
+
+		runners = append(runners, runner)
+	}
+
+	return runners
+}
@@ -10,4 +10,19 @@ type Info struct {
 	ExternalURL string `json:"external_url,omitempty"`
 	// The configured name of the Concourse cluster
 	ClusterName string `json:"cluster_name,omitempty"`
+	// The configured credential managers, if any report health individually
+	CredentialManagers []CredentialManagerInfo `json:"credential_managers,omitempty"`
+}
+
+// CredentialManagerInfo carries per-provider health for a credential
+// manager, so fly and the dashboard can display it without scraping logs.
+type CredentialManagerInfo struct {
+	// The provider id, e.g. as configured in a credential-managers-file entry
+	Name string `json:"name"`
+	// The credential manager type, e.g. "conjur" or "vault"
+	Type string `json:"type"`
+	// Whether the last health probe against this provider succeeded
+	Healthy bool `json:"healthy"`
+	// Additional provider-specific health detail, e.g. latency or authenticator type
+	Details map[string]string `json:"details,omitempty"`
 }